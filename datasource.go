@@ -0,0 +1,174 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/kballard/go-shellquote"
+)
+
+// DataSource reads the raw bytes behind a single --input entry. Pluggable
+// implementations let --input name a file, stdin, an environment variable,
+// or a remote/generated source via a "scheme://" URI.
+type DataSource interface {
+	Read() ([]byte, error)
+}
+
+// fileDataSource reads from a path on disk.
+type fileDataSource struct {
+	Path string
+}
+
+func (s fileDataSource) Read() ([]byte, error) {
+	return ioutil.ReadFile(s.Path)
+}
+
+// stdinDataSource reads all of stdin.
+type stdinDataSource struct{}
+
+func (s stdinDataSource) Read() ([]byte, error) {
+	return ioutil.ReadAll(os.Stdin)
+}
+
+// envKeyDataSource reads the value of a single environment variable.
+type envKeyDataSource struct {
+	Key string
+}
+
+func (s envKeyDataSource) Read() ([]byte, error) {
+	return []byte(os.Getenv(s.Key)), nil
+}
+
+// httpDataSource fetches input data over HTTP(S). It supports --input-header
+// for auth and, via net/http's default transport, the standard
+// HTTP_PROXY/HTTPS_PROXY/NO_PROXY environment variables.
+type httpDataSource struct {
+	URL     string
+	Headers []string
+}
+
+func (s httpDataSource) Read() ([]byte, error) {
+	req, err := http.NewRequest(http.MethodGet, s.URL, nil)
+	if err != nil {
+		return nil, err
+	}
+	for _, header := range s.Headers {
+		parts := strings.SplitN(header, ":", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("--input-header %q must be of the form \"Name: value\"", header)
+		}
+		req.Header.Add(strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1]))
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 400 {
+		return nil, fmt.Errorf("%s returned HTTP %d", s.URL, resp.StatusCode)
+	}
+	return body, nil
+}
+
+// execDataSource runs a command and uses its stdout as raw input data,
+// failing the run if the command exits non-zero or exceeds Timeout.
+type execDataSource struct {
+	Command string
+	Timeout time.Duration
+}
+
+func (s execDataSource) Read() ([]byte, error) {
+	args, err := shellquote.Split(s.Command)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse exec:// command: %s", err)
+	}
+	if len(args) == 0 {
+		return nil, fmt.Errorf("exec:// data source has an empty command")
+	}
+
+	ctx := context.Background()
+	if s.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.Timeout)
+		defer cancel()
+	}
+
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("%s: %s: %s", s.Command, err, stderr.String())
+	}
+	return stdout.Bytes(), nil
+}
+
+// resolvedDataSource bundles the DataSource for a single --input entry with
+// the path-like hint (if any) used for format sniffing by file extension.
+type resolvedDataSource struct {
+	Source DataSource
+	// ExtHint is a file-extension-bearing name (a path or URL) to fall
+	// back on for format detection when --format wasn't given explicitly.
+	ExtHint string
+}
+
+// resolveDataSource turns a single --input value into the DataSource that
+// reads it. dataFile == "" means "use the whole process environment" and is
+// handled by the caller; everything else is either a bare file path (for
+// backwards compatibility) or a "scheme://..." URI.
+func resolveDataSource(dataFile string, useEnvKey bool, headers []string, execTimeout time.Duration) (resolvedDataSource, error) {
+	if !strings.Contains(dataFile, "://") {
+		if useEnvKey {
+			return resolvedDataSource{Source: envKeyDataSource{Key: dataFile}}, nil
+		}
+		return resolvedDataSource{Source: fileDataSource{Path: dataFile}, ExtHint: dataFile}, nil
+	}
+
+	u, err := url.Parse(dataFile)
+	if err != nil {
+		return resolvedDataSource{}, fmt.Errorf("could not parse --input URI %q: %s", dataFile, err)
+	}
+
+	switch u.Scheme {
+	case "file":
+		// A relative path like "file://data.json" or "file://dir/sub.json"
+		// parses with the first path segment as the URL host, not as part
+		// of u.Path; only "file:///abs/path" (and the equivalent
+		// "file://localhost/abs/path") leaves a path usable as-is. Stitch
+		// Host back onto Path so relative file:// URIs resolve instead of
+		// silently reading an empty path.
+		path := u.Path
+		if u.Host != "" && u.Host != "localhost" {
+			path = u.Host + path
+		}
+		if path == "" {
+			path = u.Opaque
+		}
+		if path == "" {
+			return resolvedDataSource{}, fmt.Errorf("--input URI %q has no path", dataFile)
+		}
+		return resolvedDataSource{Source: fileDataSource{Path: path}, ExtHint: path}, nil
+	case "http", "https":
+		return resolvedDataSource{Source: httpDataSource{URL: dataFile, Headers: headers}, ExtHint: u.Path}, nil
+	case "exec":
+		return resolvedDataSource{Source: execDataSource{Command: strings.TrimPrefix(dataFile, "exec://"), Timeout: execTimeout}}, nil
+	case "env":
+		return resolvedDataSource{Source: envKeyDataSource{Key: u.Host}}, nil
+	default:
+		return resolvedDataSource{}, fmt.Errorf("unsupported --input URI scheme: %q", u.Scheme)
+	}
+}
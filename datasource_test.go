@@ -0,0 +1,62 @@
+package main
+
+import "testing"
+
+func TestResolveDataSourceRelativeFileURI(t *testing.T) {
+	resolved, err := resolveDataSource("file://data.json", false, nil, 0)
+	if err != nil {
+		t.Fatalf("resolveDataSource() error = %v", err)
+	}
+	fds, ok := resolved.Source.(fileDataSource)
+	if !ok {
+		t.Fatalf("resolved.Source = %#v, want fileDataSource", resolved.Source)
+	}
+	if fds.Path != "data.json" {
+		t.Errorf("fds.Path = %q, want %q", fds.Path, "data.json")
+	}
+}
+
+func TestResolveDataSourceRelativeFileURIWithSubdirectory(t *testing.T) {
+	resolved, err := resolveDataSource("file://dir/sub.json", false, nil, 0)
+	if err != nil {
+		t.Fatalf("resolveDataSource() error = %v", err)
+	}
+	fds, ok := resolved.Source.(fileDataSource)
+	if !ok {
+		t.Fatalf("resolved.Source = %#v, want fileDataSource", resolved.Source)
+	}
+	if fds.Path != "dir/sub.json" {
+		t.Errorf("fds.Path = %q, want %q", fds.Path, "dir/sub.json")
+	}
+}
+
+func TestResolveDataSourceAbsoluteFileURIWithLocalhost(t *testing.T) {
+	// "file://localhost/abs/path" is the RFC 8089 form for an absolute path
+	// with an explicit local authority; "localhost" must not be treated as
+	// a relative path segment and prepended onto the path.
+	resolved, err := resolveDataSource("file://localhost/abs/data.json", false, nil, 0)
+	if err != nil {
+		t.Fatalf("resolveDataSource() error = %v", err)
+	}
+	fds, ok := resolved.Source.(fileDataSource)
+	if !ok {
+		t.Fatalf("resolved.Source = %#v, want fileDataSource", resolved.Source)
+	}
+	if fds.Path != "/abs/data.json" {
+		t.Errorf("fds.Path = %q, want %q", fds.Path, "/abs/data.json")
+	}
+}
+
+func TestResolveDataSourceAbsoluteFileURI(t *testing.T) {
+	resolved, err := resolveDataSource("file:///abs/data.json", false, nil, 0)
+	if err != nil {
+		t.Fatalf("resolveDataSource() error = %v", err)
+	}
+	fds, ok := resolved.Source.(fileDataSource)
+	if !ok {
+		t.Fatalf("resolved.Source = %#v, want fileDataSource", resolved.Source)
+	}
+	if fds.Path != "/abs/data.json" {
+		t.Errorf("fds.Path = %q, want %q", fds.Path, "/abs/data.json")
+	}
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2/hclparse"
+	"github.com/pelletier/go-toml"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// loadTOMLData unmarshals raw TOML bytes into a generic map.
+func loadTOMLData(rawInput []byte) (map[string]interface{}, error) {
+	tree, err := toml.LoadBytes(rawInput)
+	if err != nil {
+		return nil, err
+	}
+	return tree.ToMap(), nil
+}
+
+// loadHCLData unmarshals raw HCL bytes into a generic map. Only top-level
+// attributes are supported (no nested blocks), which matches the flat
+// key/value data p2cli's other formats already expect.
+func loadHCLData(rawInput []byte) (map[string]interface{}, error) {
+	parser := hclparse.NewParser()
+	file, diags := parser.ParseHCL(rawInput, "input.hcl")
+	if diags.HasErrors() {
+		return nil, diags
+	}
+
+	attrs, diags := file.Body.JustAttributes()
+	if diags.HasErrors() {
+		return nil, diags
+	}
+
+	data := make(map[string]interface{}, len(attrs))
+	for name, attr := range attrs {
+		value, diags := attr.Expr.Value(nil)
+		if diags.HasErrors() {
+			return nil, diags
+		}
+		data[name] = ctyToGo(value)
+	}
+	return data, nil
+}
+
+// ctyToGo converts a cty.Value (as produced by evaluating an HCL
+// expression) into the same plain Go types the JSON/YAML loaders produce.
+func ctyToGo(v cty.Value) interface{} {
+	if v.IsNull() {
+		return nil
+	}
+	switch {
+	case v.Type() == cty.String:
+		return v.AsString()
+	case v.Type() == cty.Bool:
+		return v.True()
+	case v.Type() == cty.Number:
+		f, _ := v.AsBigFloat().Float64()
+		return f
+	case v.Type().IsObjectType() || v.Type().IsMapType():
+		m := make(map[string]interface{})
+		for it := v.ElementIterator(); it.Next(); {
+			k, ev := it.Element()
+			m[k.AsString()] = ctyToGo(ev)
+		}
+		return m
+	case v.CanIterateElements():
+		var list []interface{}
+		for it := v.ElementIterator(); it.Next(); {
+			_, ev := it.Element()
+			list = append(list, ctyToGo(ev))
+		}
+		return list
+	default:
+		return fmt.Sprintf("%v", v)
+	}
+}
+
+// sniffFormat tries each supported format in turn (JSON, then YAML, then
+// TOML, then the env key=value pattern) and returns the first one that
+// parses cleanly. It's used for --format auto, when neither a file
+// extension nor an explicit --format disambiguates the input.
+func sniffFormat(rawInput []byte) (map[string]interface{}, error) {
+	var errs []string
+
+	if data, err := loadJSONData(rawInput); err == nil {
+		return data, nil
+	} else {
+		errs = append(errs, fmt.Sprintf("json: %s", err))
+	}
+
+	if data, err := loadYAMLData(rawInput); err == nil {
+		return data, nil
+	} else {
+		errs = append(errs, fmt.Sprintf("yaml: %s", err))
+	}
+
+	if data, err := loadTOMLData(rawInput); err == nil {
+		return data, nil
+	} else {
+		errs = append(errs, fmt.Sprintf("toml: %s", err))
+	}
+
+	if data, err := loadEnvData(rawInput, false); err == nil {
+		return data, nil
+	} else {
+		errs = append(errs, fmt.Sprintf("env: %s", err))
+	}
+
+	return nil, fmt.Errorf("could not auto-detect input format; tried:\n%s", strings.Join(errs, "\n"))
+}
@@ -0,0 +1,52 @@
+package main
+
+import "testing"
+
+func TestLoadTOMLData(t *testing.T) {
+	data, err := loadTOMLData([]byte("name = \"p2cli\"\ncount = 3\n"))
+	if err != nil {
+		t.Fatalf("loadTOMLData() error = %v", err)
+	}
+	if data["name"] != "p2cli" {
+		t.Errorf("data[\"name\"] = %#v, want \"p2cli\"", data["name"])
+	}
+}
+
+func TestSniffFormatJSON(t *testing.T) {
+	data, err := sniffFormat([]byte(`{"name": "p2cli"}`))
+	if err != nil {
+		t.Fatalf("sniffFormat() error = %v", err)
+	}
+	if data["name"] != "p2cli" {
+		t.Errorf("data[\"name\"] = %#v, want \"p2cli\"", data["name"])
+	}
+}
+
+func TestSniffFormatEnvFallback(t *testing.T) {
+	data, err := sniffFormat([]byte("NAME=p2cli\n"))
+	if err != nil {
+		t.Fatalf("sniffFormat() error = %v", err)
+	}
+	if data["NAME"] != "p2cli" {
+		t.Errorf("data[\"NAME\"] = %#v, want \"p2cli\"", data["NAME"])
+	}
+}
+
+func TestSniffFormatEnvFallbackAllowsEmptyValue(t *testing.T) {
+	// json/yaml/toml all reject "EMPTY=\n", so sniffFormat falls through to
+	// the env parser; that used to panic on a key with no value instead of
+	// returning the aggregated diagnostic (or, here, succeeding).
+	data, err := sniffFormat([]byte("EMPTY=\n"))
+	if err != nil {
+		t.Fatalf("sniffFormat() error = %v", err)
+	}
+	if data["EMPTY"] != "" {
+		t.Errorf("data[\"EMPTY\"] = %#v, want \"\"", data["EMPTY"])
+	}
+}
+
+func TestSniffFormatAllFail(t *testing.T) {
+	if _, err := sniffFormat([]byte("{{{ not json, not toml, no equals sign\n  - stray list marker")); err == nil {
+		t.Error("expected an error when no parser can handle the input")
+	}
+}
@@ -0,0 +1,294 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/kballard/go-shellquote"
+	"gopkg.in/yaml.v2"
+)
+
+// loadEnvData parses key=value (sourced-shell-style) data, either from the
+// real process environment or from raw bytes read from a file/stdin/env key.
+func loadEnvData(rawInput []byte, fromProcessEnviron bool) (map[string]interface{}, error) {
+	data := make(map[string]interface{})
+
+	if fromProcessEnviron {
+		for _, keyval := range os.Environ() {
+			splitKeyVal := strings.SplitN(keyval, "=", 2)
+			if len(splitKeyVal) != 2 {
+				return nil, ErrorEnvironmentVariables{
+					Reason:    "Could not find an equals value to split on",
+					RawEnvVar: keyval,
+				}
+			}
+			data[splitKeyVal[0]] = splitKeyVal[1]
+		}
+		return data, nil
+	}
+
+	lineScanner := bufio.NewScanner(bytes.NewReader(rawInput))
+	for lineScanner.Scan() {
+		keyval := lineScanner.Text()
+		splitKeyVal := strings.SplitN(keyval, "=", 2)
+		if len(splitKeyVal) != 2 {
+			return nil, ErrorEnvironmentVariables{
+				Reason:    "Could not find an equals value to split on",
+				RawEnvVar: keyval,
+			}
+		}
+		// File values should support sh-escaped strings, whereas the
+		// raw environment will accept *anything* after the = sign.
+		values, err := shellquote.Split(splitKeyVal[1])
+		if err != nil {
+			return nil, ErrorEnvironmentVariables{
+				Reason:    err.Error(),
+				RawEnvVar: keyval,
+			}
+		}
+
+		// Detect if more then 1 values was parsed - this is invalid in
+		// sourced files, and we don't want to try parsing shell arrays.
+		if len(values) > 1 {
+			return nil, ErrorEnvironmentVariables{
+				Reason:    "Improperly escaped environment variable. p2 does not parse arrays.",
+				RawEnvVar: keyval,
+			}
+		}
+
+		// An empty value (e.g. "KEY=") shellquotes to zero tokens rather
+		// than one empty one.
+		if len(values) == 0 {
+			data[splitKeyVal[0]] = ""
+			continue
+		}
+
+		data[splitKeyVal[0]] = values[0]
+	}
+	return data, nil
+}
+
+// loadYAMLData unmarshals raw YAML bytes into a generic map.
+func loadYAMLData(rawInput []byte) (map[string]interface{}, error) {
+	data := make(map[string]interface{})
+	if err := yaml.Unmarshal(rawInput, &data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// loadJSONData unmarshals raw JSON bytes into a generic map.
+func loadJSONData(rawInput []byte) (map[string]interface{}, error) {
+	data := make(map[string]interface{})
+	if err := json.Unmarshal(rawInput, &data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// loadData reads and parses a single --input entry into a generic map.
+// dataFile may be blank (the whole process environment), a bare file path,
+// or a "scheme://" URI resolved by resolveDataSource (file/http/https/exec/
+// env). headers and execTimeout only matter for http:// and exec:// sources,
+// respectively. formatSet distinguishes an explicit --format from its
+// "env" default, so that a bare --input with an unrecognized extension
+// falls through to auto-sniffing instead of being forced through the
+// default env-format parser.
+func loadData(dataFile string, format string, formatSet bool, useEnvKey bool, headers []string, execTimeout time.Duration) (map[string]interface{}, error) {
+	effectiveFormat := format
+	if !formatSet {
+		effectiveFormat = ""
+	}
+
+	if dataFile == "" && effectiveFormat == "" {
+		return loadEnvData(nil, true)
+	}
+
+	var fileFormat SupportedType
+	var source DataSource
+
+	if dataFile == "" {
+		// --format given but no --input: read from stdin.
+		var ok bool
+		fileFormat, ok = dataFormats[effectiveFormat]
+		if !ok {
+			return nil, fmt.Errorf("unsupported input format: %s", effectiveFormat)
+		}
+		source = stdinDataSource{}
+	} else {
+		resolved, err := resolveDataSource(dataFile, useEnvKey, headers, execTimeout)
+		if err != nil {
+			return nil, err
+		}
+		source = resolved.Source
+
+		if effectiveFormat != "" {
+			var ok bool
+			fileFormat, ok = dataFormats[effectiveFormat]
+			if !ok {
+				return nil, fmt.Errorf("unsupported input format: %s", effectiveFormat)
+			}
+		} else if resolved.ExtHint == "" {
+			// Sources with no path-like hint (--use-env-key, exec://,
+			// env://) have nothing to sniff an extension from; keep the
+			// historical default of env-style key=value parsing rather
+			// than guessing from content.
+			fileFormat = TypeEnv
+		} else if ext, ok := dataFormats[strings.TrimLeft(path.Ext(resolved.ExtHint), ".")]; ok {
+			fileFormat = ext
+		} else {
+			// Neither --format nor the file extension disambiguate the
+			// input, so sniff its content instead of giving up.
+			fileFormat = TypeAuto
+		}
+	}
+
+	rawInput, err := source.Read()
+	if err != nil {
+		return nil, fmt.Errorf("could not read data from %q: %s", dataFile, err)
+	}
+
+	switch fileFormat {
+	case TypeEnv:
+		return loadEnvData(rawInput, false)
+	case TypeYAML:
+		return loadYAMLData(rawInput)
+	case TypeJSON:
+		return loadJSONData(rawInput)
+	case TypeTOML:
+		return loadTOMLData(rawInput)
+	case TypeHCL:
+		return loadHCLData(rawInput)
+	case TypeAuto:
+		return sniffFormat(rawInput)
+	default:
+		return nil, fmt.Errorf("unknown input format")
+	}
+}
+
+// deepMerge merges src into dst, recursing into nested maps so that only
+// the specific overlapping keys are replaced. Lists and scalars in src
+// always replace whatever is in dst; nil values in src are treated like any
+// other value and also replace dst, per "later wins" semantics.
+func deepMerge(dst, src map[string]interface{}) map[string]interface{} {
+	if dst == nil {
+		dst = make(map[string]interface{})
+	}
+	for key, srcVal := range src {
+		if dstVal, ok := dst[key]; ok {
+			dstMap, dstIsMap := asStringMap(dstVal)
+			srcMap, srcIsMap := asStringMap(srcVal)
+			if dstIsMap && srcIsMap {
+				dst[key] = deepMerge(dstMap, srcMap)
+				continue
+			}
+		}
+		dst[key] = srcVal
+	}
+	return dst
+}
+
+// asStringMap normalizes the two map shapes our parsers can produce
+// (map[string]interface{} from JSON/env, map[interface{}]interface{} from
+// YAML) down to a single type so deepMerge can recurse uniformly.
+func asStringMap(v interface{}) (map[string]interface{}, bool) {
+	switch m := v.(type) {
+	case map[string]interface{}:
+		return m, true
+	case map[interface{}]interface{}:
+		out := make(map[string]interface{}, len(m))
+		for k, val := range m {
+			out[fmt.Sprintf("%v", k)] = val
+		}
+		return out, true
+	default:
+		return nil, false
+	}
+}
+
+// setOverride applies a single "--set key.path=value" override on top of
+// data, creating intermediate maps as needed. Values are always stored as
+// strings, consistent with how env-format input is treated elsewhere.
+func setOverride(data map[string]interface{}, override string) error {
+	splitOverride := strings.SplitN(override, "=", 2)
+	if len(splitOverride) != 2 {
+		return fmt.Errorf("--set value %q must be of the form key.path=value", override)
+	}
+	keyPath := strings.Split(splitOverride[0], ".")
+	value := splitOverride[1]
+
+	cur := data
+	for i, key := range keyPath {
+		if i == len(keyPath)-1 {
+			cur[key] = value
+			return nil
+		}
+		next, ok := cur[key]
+		if !ok {
+			nextMap := make(map[string]interface{})
+			cur[key] = nextMap
+			cur = nextMap
+			continue
+		}
+		nextMap, ok := asStringMap(next)
+		if !ok {
+			return fmt.Errorf("--set %q conflicts with a non-map value already at %q", override, strings.Join(keyPath[:i+1], "."))
+		}
+		// next may have been a map[interface{}]interface{} (e.g. from YAML),
+		// in which case asStringMap returned a converted copy. Write it back
+		// so our mutations land in data instead of an orphaned copy.
+		cur[key] = nextMap
+		cur = nextMap
+	}
+	return nil
+}
+
+// loadEnvironmentOverlay looks up environments.<name>.values in data and
+// merges each entry (a file path, or an inline map) on top of data in
+// order, mirroring helmfile's environments: block.
+func loadEnvironmentOverlay(data map[string]interface{}, name string) (map[string]interface{}, error) {
+	environments, ok := asStringMap(data["environments"])
+	if !ok {
+		return nil, fmt.Errorf("--environment %q requested but no top-level \"environments\" map was found in the input data", name)
+	}
+	envRaw, ok := environments[name]
+	if !ok {
+		return nil, fmt.Errorf("--environment %q not found under \"environments\"", name)
+	}
+	env, ok := asStringMap(envRaw)
+	if !ok {
+		return nil, fmt.Errorf("environments.%s must be a map", name)
+	}
+	valuesRaw, ok := env["values"]
+	if !ok {
+		return data, nil
+	}
+	values, ok := valuesRaw.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("environments.%s.values must be a list", name)
+	}
+
+	for _, valueEntry := range values {
+		switch v := valueEntry.(type) {
+		case string:
+			overlay, err := loadData(v, "", false, false, nil, 0)
+			if err != nil {
+				return nil, fmt.Errorf("could not load environments.%s.values entry %q: %s", name, v, err)
+			}
+			data = deepMerge(data, overlay)
+		default:
+			overlayMap, ok := asStringMap(v)
+			if !ok {
+				return nil, fmt.Errorf("environments.%s.values entries must be a file path or an inline map", name)
+			}
+			data = deepMerge(data, overlayMap)
+		}
+	}
+	return data, nil
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestDeepMergePrecedence(t *testing.T) {
+	dst := map[string]interface{}{
+		"name": "base",
+		"nested": map[string]interface{}{
+			"a": 1,
+			"b": 2,
+		},
+		"list": []interface{}{"x"},
+	}
+	src := map[string]interface{}{
+		"name": "override",
+		"nested": map[string]interface{}{
+			"b": 3,
+			"c": 4,
+		},
+		"list": []interface{}{"y", "z"},
+	}
+
+	got := deepMerge(dst, src)
+
+	want := map[string]interface{}{
+		"name": "override",
+		"nested": map[string]interface{}{
+			"a": 1,
+			"b": 3,
+			"c": 4,
+		},
+		"list": []interface{}{"y", "z"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("deepMerge() = %#v, want %#v", got, want)
+	}
+}
+
+func TestDeepMergeNilDestination(t *testing.T) {
+	src := map[string]interface{}{"key": "value"}
+	got := deepMerge(nil, src)
+	if !reflect.DeepEqual(got, src) {
+		t.Errorf("deepMerge(nil, src) = %#v, want %#v", got, src)
+	}
+}
+
+func TestDeepMergeTypeConflict(t *testing.T) {
+	dst := map[string]interface{}{"key": map[string]interface{}{"a": 1}}
+	src := map[string]interface{}{"key": "scalar"}
+
+	got := deepMerge(dst, src)
+	if got["key"] != "scalar" {
+		t.Errorf("expected a scalar src value to replace a map dst value outright, got %#v", got["key"])
+	}
+}
+
+func TestLoadEnvDataAllowsEmptyValue(t *testing.T) {
+	data, err := loadEnvData([]byte("EMPTY=\nNAME=p2cli\n"), false)
+	if err != nil {
+		t.Fatalf("loadEnvData() error = %v", err)
+	}
+	if data["EMPTY"] != "" {
+		t.Errorf("data[\"EMPTY\"] = %#v, want \"\"", data["EMPTY"])
+	}
+	if data["NAME"] != "p2cli" {
+		t.Errorf("data[\"NAME\"] = %#v, want \"p2cli\"", data["NAME"])
+	}
+}
+
+func TestSetOverrideCreatesNestedPath(t *testing.T) {
+	data := map[string]interface{}{}
+	if err := setOverride(data, "a.b.c=value"); err != nil {
+		t.Fatalf("setOverride() error = %v", err)
+	}
+
+	nested, ok := asStringMap(data["a"])
+	if !ok {
+		t.Fatalf("expected data[\"a\"] to be a map, got %#v", data["a"])
+	}
+	nested, ok = asStringMap(nested["b"])
+	if !ok {
+		t.Fatalf("expected data[\"a\"][\"b\"] to be a map, got data[\"a\"] = %#v", data["a"])
+	}
+	if nested["c"] != "value" {
+		t.Errorf("data[\"a\"][\"b\"][\"c\"] = %#v, want \"value\"", nested["c"])
+	}
+}
+
+func TestSetOverrideRejectsMissingEquals(t *testing.T) {
+	if err := setOverride(map[string]interface{}{}, "a.b.novalue"); err == nil {
+		t.Error("expected an error for a --set value missing '='")
+	}
+}
+
+func TestLoadDataFallsBackToExtensionWhenFormatNotExplicit(t *testing.T) {
+	// --format defaults to "env", but that default must not shadow
+	// extension-based detection when the user never actually passed -f.
+	dir := t.TempDir()
+	dataFile := filepath.Join(dir, "data.json")
+	if err := os.WriteFile(dataFile, []byte(`{"name": "p2cli"}`), 0644); err != nil {
+		t.Fatalf("could not write fixture file: %v", err)
+	}
+
+	data, err := loadData(dataFile, "env", false, false, nil, 0)
+	if err != nil {
+		t.Fatalf("loadData() error = %v", err)
+	}
+	if data["name"] != "p2cli" {
+		t.Errorf("data[\"name\"] = %#v, want \"p2cli\"", data["name"])
+	}
+}
+
+func TestLoadDataHonorsExplicitFormatOverExtension(t *testing.T) {
+	dir := t.TempDir()
+	dataFile := filepath.Join(dir, "data.json")
+	if err := os.WriteFile(dataFile, []byte("NAME=p2cli\n"), 0644); err != nil {
+		t.Fatalf("could not write fixture file: %v", err)
+	}
+
+	data, err := loadData(dataFile, "env", true, false, nil, 0)
+	if err != nil {
+		t.Fatalf("loadData() error = %v", err)
+	}
+	if data["NAME"] != "p2cli" {
+		t.Errorf("data[\"NAME\"] = %#v, want \"p2cli\"", data["NAME"])
+	}
+}
+
+func TestLoadDataKeepsEnvFormatForUseEnvKeyWithoutExplicitFormat(t *testing.T) {
+	// --use-env-key sources have no path to sniff an extension from; they
+	// must keep parsing as env-style key=value rather than falling through
+	// to content sniffing, which could misread a value like "true" as a
+	// bool instead of the traditional string.
+	t.Setenv("P2CLI_TEST_USE_ENV_KEY", "ENABLED=true")
+
+	data, err := loadData("P2CLI_TEST_USE_ENV_KEY", "env", false, true, nil, 0)
+	if err != nil {
+		t.Fatalf("loadData() error = %v", err)
+	}
+	if data["ENABLED"] != "true" {
+		t.Errorf("data[\"ENABLED\"] = %#v, want the string \"true\"", data["ENABLED"])
+	}
+}
+
+func TestSetOverrideDescendsIntoYAMLSourcedMap(t *testing.T) {
+	// gopkg.in/yaml.v2 produces map[interface{}]interface{} for nested
+	// maps, not map[string]interface{}; setOverride must still mutate it
+	// in place rather than descending into a converted copy.
+	data := map[string]interface{}{
+		"db": map[interface{}]interface{}{
+			"host": "old-host",
+		},
+	}
+	if err := setOverride(data, "db.host=new-host"); err != nil {
+		t.Fatalf("setOverride() error = %v", err)
+	}
+
+	db, ok := asStringMap(data["db"])
+	if !ok {
+		t.Fatalf("expected data[\"db\"] to be a map, got %#v", data["db"])
+	}
+	if db["host"] != "new-host" {
+		t.Errorf("data[\"db\"][\"host\"] = %#v, want \"new-host\"", db["host"])
+	}
+}
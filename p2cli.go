@@ -9,22 +9,15 @@ python.
 package main
 
 import (
-	"bufio"
-	"bytes"
-	"encoding/json"
 	"fmt"
-	"io"
-	"io/ioutil"
 	"os"
-	"path"
 	"strings"
+	"time"
 
 	"github.com/alecthomas/kingpin"
 
 	"github.com/flosch/pongo2"
-	"github.com/kballard/go-shellquote"
 	log "github.com/wrouesnel/go.log"
-	"gopkg.in/yaml.v2"
 )
 
 // Version is populated by the build system.
@@ -42,20 +35,12 @@ const (
 	TypeYAML SupportedType = iota
 	// TypeEnv is key=value pseudo environment files.
 	TypeEnv SupportedType = iota
-)
-
-// DataSource is an enumeration of the sources of input data we can take.
-type DataSource int
-
-const (
-	// SourceEnv means input comes from environment variables
-	SourceEnv DataSource = iota
-	// SourceEnvKey means input comes from the value of a specific environment key
-	SourceEnvKey DataSource = iota
-	// SourceStdin means input comes from stdin
-	SourceStdin DataSource = iota
-	// SourceFile means input comes from a file
-	SourceFile DataSource = iota
+	// TypeTOML is TOML
+	TypeTOML SupportedType = iota
+	// TypeHCL is HCL
+	TypeHCL SupportedType = iota
+	// TypeAuto means the format should be sniffed from the input's content.
+	TypeAuto SupportedType = iota
 )
 
 var dataFormats = map[string]SupportedType{
@@ -63,6 +48,9 @@ var dataFormats = map[string]SupportedType{
 	"yaml": TypeYAML,
 	"yml":  TypeYAML,
 	"env":  TypeEnv,
+	"toml": TypeTOML,
+	"hcl":  TypeHCL,
+	"auto": TypeAuto,
 }
 
 // CustomFilterSpec is a map of custom filters p2 implements. These are gated
@@ -79,10 +67,6 @@ var customFilters = map[string]CustomFilterSpec{
 	"make_dirs":  {filterMakeDirs, filterNoopPassthru},
 }
 
-var (
-	inputData = make(map[string]interface{})
-)
-
 // ErrorEnvironmentVariables is raised when an environment variable is improperly formatted
 type ErrorEnvironmentVariables struct {
 	Reason    string
@@ -94,32 +78,6 @@ func (eev ErrorEnvironmentVariables) Error() string {
 	return fmt.Sprintf("%s: %s", eev.Reason, eev.RawEnvVar)
 }
 
-func readRawInput(name string, source DataSource) ([]byte, error) {
-	var data []byte
-	var err error
-	switch source {
-	case SourceStdin:
-		// Read from stdin
-		name = "-"
-		data, err = ioutil.ReadAll(os.Stdin)
-	case SourceFile:
-		// Read from file
-		data, err = ioutil.ReadFile(name)
-	case SourceEnvKey:
-		// Read from environment key
-		data = []byte(os.Getenv(name))
-	default:
-		log.With("filename", name).Errorln("Invalid data source specified.")
-		return []byte{}, err
-	}
-
-	if err != nil {
-		log.With("filename", name).Errorln("Could not read data:", err)
-		return []byte{}, err
-	}
-	return data, nil
-}
-
 func main() {
 	os.Exit(realMain())
 }
@@ -128,11 +86,27 @@ func realMain() int {
 	options := struct {
 		DumpInputData bool
 
-		Format       string
-		UseEnvKey    bool
-		TemplateFile string
-		DataFile     string
-		OutputFile   string
+		Format         string
+		FormatExplicit bool
+		UseEnvKey      bool
+		TemplateFiles  []string
+		DataFiles      []string
+		Environment    string
+		SetOverrides   []string
+		OutputFiles    []string
+		OutputDir      string
+		StripSuffix    string
+		DryRun         bool
+
+		InputHeaders     []string
+		InputExecTimeout time.Duration
+
+		Watch      bool
+		WatchPaths []string
+		WatchDelay time.Duration
+		OnChange   string
+
+		PostProcess string
 
 		CustomFilters     string
 		CustomFilterNoops bool
@@ -146,13 +120,29 @@ func realMain() int {
 	app.Version(Version)
 
 	app.Flag("debug", "Print Go serialization to stderr and then exit").Short('d').BoolVar(&options.DumpInputData)
-	app.Flag("format", "Input data format").Default("env").Short('f').EnumVar(&options.Format, "env", "envkey", "json", "yml", "yaml")
+	app.Flag("format", "Input data format. When left at its default and a file or http(s):// --input has an unrecognized or missing extension, the content is auto-sniffed instead of erroring; --use-env-key, exec:// and env:// inputs are parsed as env.").
+		Default("env").Short('f').IsSetByUser(&options.FormatExplicit).
+		EnumVar(&options.Format, "env", "envkey", "json", "yml", "yaml", "toml", "hcl", "auto")
 
 	app.Flag("use-env-key", "Treat --input as an environment key name to read.").BoolVar(&options.UseEnvKey)
 
-	app.Flag("template", "Template file to process").Short('t').Required().StringVar(&options.TemplateFile)
-	app.Flag("input", "Input data path. Leave blank for stdin.").Short('i').StringVar(&options.DataFile)
-	app.Flag("output", "Output file. Leave blank for stdout.").Short('o').StringVar(&options.OutputFile)
+	app.Flag("template", "Template file to process. May be repeated, and may contain glob/doublestar patterns (e.g. 'configs/**/*.j2').").Short('t').Required().StringsVar(&options.TemplateFiles)
+	app.Flag("input", "Input data path. Leave blank for stdin. May be repeated; later files are deep-merged on top of earlier ones. Accepts file://, http(s)://, exec:// and env:// URIs in addition to bare paths.").Short('i').StringsVar(&options.DataFiles)
+	app.Flag("input-header", "\"Name: value\" header to send with http(s):// --input requests. May be repeated.").StringsVar(&options.InputHeaders)
+	app.Flag("input-exec-timeout", "Timeout for exec:// --input commands.").Default("30s").DurationVar(&options.InputExecTimeout)
+	app.Flag("environment", "Name of an environments.<name>.values overlay (in the merged input data) to merge on top, helmfile-style.").Short('e').StringVar(&options.Environment)
+	app.Flag("set", "Override a single key.path=value in the merged input data. May be repeated; applied after --environment.").StringsVar(&options.SetOverrides)
+	app.Flag("output", "Output file. Leave blank for stdout. May be repeated to match a repeated --template 1:1.").Short('o').StringsVar(&options.OutputFiles)
+	app.Flag("output-dir", "Directory to mirror rendered --template paths into, stripping --strip-suffix from each filename.").StringVar(&options.OutputDir)
+	app.Flag("strip-suffix", "Suffix to strip from template filenames when writing into --output-dir (e.g. '.j2').").StringVar(&options.StripSuffix)
+	app.Flag("dry-run", "Report which files would be written without actually rendering them.").BoolVar(&options.DryRun)
+
+	app.Flag("watch", "Keep running and re-render whenever a template, --input file, or --watch-path file changes.").BoolVar(&options.Watch)
+	app.Flag("watch-path", "Additional glob pattern to watch for changes in --watch mode. May be repeated.").StringsVar(&options.WatchPaths)
+	app.Flag("watch-delay", "Debounce window for coalescing bursts of filesystem events in --watch mode.").Default("100ms").DurationVar(&options.WatchDelay)
+	app.Flag("on-change", "Shell command to run after each successful re-render in --watch mode.").StringVar(&options.OnChange)
+
+	app.Flag("postprocess", "Reformat rendered output before writing it.").EnumVar(&options.PostProcess, "gofmt", "goimports", "jsonpretty", "yamlnormalize")
 
 	app.Flag("enable-filters", "Enable custom p2 filters.").StringVar(&options.CustomFilters)
 	app.Flag("enable-noop-filters", "Enable all custom filters in noop mode. Supercedes --enable-filters").BoolVar(&options.CustomFilterNoops)
@@ -161,11 +151,6 @@ func realMain() int {
 
 	kingpin.MustParse(app.Parse(os.Args[1:]))
 
-	if options.TemplateFile == "" {
-		log.Errorln("Template file must be specified!")
-		return 1
-	}
-
 	// Register custom filter functions.
 	if options.CustomFilterNoops {
 		for filter, spec := range customFilters {
@@ -186,168 +171,116 @@ func realMain() int {
 		}
 	}
 
-	// Determine mode of operations
-	var fileFormat SupportedType
-	inputSource := SourceEnv
-	if options.DataFile == "" && options.Format == "" {
-		fileFormat = TypeEnv
-		inputSource = SourceEnv
-	} else if options.DataFile != "" && options.Format == "" {
-		var ok bool
-		fileFormat, ok = dataFormats[strings.TrimLeft(path.Ext(options.DataFile), ".")]
-		if !ok {
-			log.Errorln("Unrecognized file extension. If the file is in a supported format, try specifying it explicitly.")
-			return 1
-		}
-		inputSource = SourceFile
-	} else if options.DataFile == "" && options.Format != "" {
-		var ok bool
-		fileFormat, ok = dataFormats[options.Format]
-		if !ok {
-			log.Errorln("Unsupported input format:", options.Format)
-			return 1
-		}
-		inputSource = SourceStdin
-	} else {
-		var ok bool
-		fileFormat, ok = dataFormats[options.Format]
-		if !ok {
-			log.Errorln("Unsupported input format:", options.Format)
-			return 1
-		}
-		inputSource = SourceFile
-	}
-
-	if options.UseEnvKey && options.DataFile == "" {
+	if options.UseEnvKey && len(options.DataFiles) == 0 {
 		log.Errorln("--use-env-key is incompatible with stdin file input.")
-	} else if options.UseEnvKey {
-		inputSource = SourceEnvKey
-	}
-
-	// Load template
-	templateBytes, err := ioutil.ReadFile(options.TemplateFile)
-	if err != nil {
-		log.Errorln("Could not read template file:", err)
-		return 1
-	}
-
-	templateString := string(templateBytes)
-	if !options.Autoescape {
-		pongo2.SetAutoescape(false)
 	}
 
-	tmpl, err := pongo2.FromString(templateString)
+	// Resolve --template/--output/--output-dir into concrete render jobs
+	// up front, so a bad combination is reported before we bother loading
+	// input data.
+	jobs, err := buildTemplateJobs(options.TemplateFiles, options.OutputFiles, options.OutputDir, options.StripSuffix)
 	if err != nil {
-		log.With("template", options.TemplateFile).
-			Errorln("Could not template file:", err)
+		log.Errorln(err)
 		return 1
 	}
 
-	// Get the input context
-	switch fileFormat {
-	case TypeEnv:
-		err = func(inputData map[string]interface{}) error {
-			if inputSource != SourceEnv {
-				rawInput, err := readRawInput(options.DataFile, inputSource)
+	// loadAndRender reloads input data (--input files may have changed
+	// under --watch) and re-renders every job. It's used both for the
+	// normal one-shot invocation and for every re-render triggered by
+	// --watch.
+	loadAndRender := func() error {
+		data := make(map[string]interface{})
+		var loadErr error
+		if len(options.DataFiles) == 0 {
+			data, loadErr = loadData("", options.Format, options.FormatExplicit, options.UseEnvKey, options.InputHeaders, options.InputExecTimeout)
+		} else {
+			for _, dataFile := range options.DataFiles {
+				layer, err := loadData(dataFile, options.Format, options.FormatExplicit, options.UseEnvKey, options.InputHeaders, options.InputExecTimeout)
 				if err != nil {
-					return err
-				}
-				lineScanner := bufio.NewScanner(bytes.NewReader(rawInput))
-				for lineScanner.Scan() {
-					keyval := lineScanner.Text()
-					splitKeyVal := strings.SplitN(lineScanner.Text(), "=", 2)
-					if len(splitKeyVal) != 2 {
-						return error(ErrorEnvironmentVariables{
-							Reason:    "Could not find an equals value to split on",
-							RawEnvVar: keyval,
-						})
-					}
-					// File values should support sh-escaped strings, whereas the
-					// raw environment will accept *anything* after the = sign.
-					values, err := shellquote.Split(splitKeyVal[1])
-					if err != nil {
-						return error(ErrorEnvironmentVariables{
-							Reason:    err.Error(),
-							RawEnvVar: keyval,
-						})
-					}
-
-					// Detect if more then 1 values was parsed - this is invalid in
-					// sourced files, and we don't want to try parsing shell arrays.
-					if len(values) > 1 {
-						return error(ErrorEnvironmentVariables{
-							Reason:    "Improperly escaped environment variable. p2 does not parse arrays.",
-							RawEnvVar: keyval,
-						})
-					}
-
-					inputData[splitKeyVal[0]] = values[0]
-				}
-			} else {
-				for _, keyval := range os.Environ() {
-					splitKeyVal := strings.SplitN(keyval, "=", 2)
-					if len(splitKeyVal) != 2 {
-						return error(ErrorEnvironmentVariables{
-							Reason:    "Could not find an equals value to split on",
-							RawEnvVar: keyval,
-						})
-					}
-
-					inputData[splitKeyVal[0]] = splitKeyVal[1]
+					loadErr = err
+					break
 				}
+				data = deepMerge(data, layer)
 			}
-			return nil
-		}(inputData)
-	case TypeYAML:
-		var rawInput []byte
-		rawInput, err = readRawInput(options.DataFile, inputSource)
-		if err != nil {
-			return 1
 		}
-		err = yaml.Unmarshal(rawInput, &inputData)
-	case TypeJSON:
-		var rawInput []byte
-		rawInput, err = readRawInput(options.DataFile, inputSource)
-		if err != nil {
-			return 1
+		if loadErr != nil {
+			return fmt.Errorf("error parsing input data (%s): %s", strings.Join(options.DataFiles, ","), loadErr)
 		}
-		err = json.Unmarshal(rawInput, &inputData)
-	default:
-		log.Errorln("Unknown input format.")
-		return 1
-	}
 
-	if err != nil {
-		log.With("template", options.TemplateFile).
-			With("data", options.DataFile).
-			Errorln("Error parsing input data:", err)
-		return 1
-	}
+		// A --environment overlay is looked up in the merged data and
+		// applied on top of it, analogous to helmfile's environments:
+		// block.
+		if options.Environment != "" {
+			data, loadErr = loadEnvironmentOverlay(data, options.Environment)
+			if loadErr != nil {
+				return fmt.Errorf("error applying --environment overlay: %s", loadErr)
+			}
+		}
 
-	if options.DumpInputData {
-		_, _ = fmt.Fprintln(os.Stderr, inputData)
+		// --set overrides are applied last, so they always win.
+		for _, override := range options.SetOverrides {
+			if err := setOverride(data, override); err != nil {
+				return err
+			}
+		}
+
+		if options.DumpInputData {
+			_, _ = fmt.Fprintln(os.Stderr, data)
+		}
+
+		// Everything loaded, so try rendering the template(s). Individual
+		// job failures are logged but do not stop the remaining jobs from
+		// running.
+		renderer := &Renderer{
+			Context:     pongo2.Context(data),
+			Autoescape:  options.Autoescape,
+			DryRun:      options.DryRun,
+			StripSuffix: options.StripSuffix,
+			PostProcess: options.PostProcess,
+		}
+		if failures := renderer.RenderAll(jobs); failures > 0 {
+			return fmt.Errorf("%d of %d template(s) failed to render", failures, len(jobs))
+		}
+		return nil
 	}
 
-	var outputWriter io.Writer
-	if options.OutputFile != "" {
-		fileOut, err := os.OpenFile(options.OutputFile, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, os.FileMode(0777))
-		if err != nil {
-			log.Errorln("Error opening output file for writing:", err)
+	if !options.Watch {
+		if err := loadAndRender(); err != nil {
+			log.Errorln(err)
 			return 1
 		}
-		defer func() { _ = fileOut.Close() }()
-		outputWriter = io.Writer(fileOut)
-	} else {
-		outputWriter = os.Stdout
+		return 0
 	}
 
-	// Everything loaded, so try rendering the template.
-	err = tmpl.ExecuteWriter(pongo2.Context(inputData), outputWriter)
+	watchedFiles, err := watchedFilesFor(jobs, options.DataFiles, options.WatchPaths)
 	if err != nil {
-		log.With("template", options.TemplateFile).
-			With("data", options.DataFile).
-			Errorln("Error parsing input data:", err)
+		log.Errorln("Could not resolve --watch-path patterns:", err)
+		return 1
+	}
+	if err := RunWatcher(watchOptions{
+		WatchedFiles: watchedFiles,
+		Delay:        options.WatchDelay,
+		OnChange:     options.OnChange,
+	}, loadAndRender); err != nil {
+		log.Errorln("Watcher failed:", err)
 		return 1
 	}
 	return 0
 }
+
+// watchedFilesFor collects the full set of files --watch should monitor:
+// every template job's source, every --input file, and anything matched by
+// --watch-path.
+func watchedFilesFor(jobs []TemplateJob, dataFiles []string, watchPaths []string) ([]string, error) {
+	watched := make([]string, 0, len(jobs)+len(dataFiles))
+	for _, job := range jobs {
+		watched = append(watched, job.TemplatePath)
+	}
+	watched = append(watched, dataFiles...)
+
+	extra, err := expandTemplates(watchPaths)
+	if err != nil {
+		return nil, err
+	}
+	return append(watched, extra...), nil
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"go/format"
+	"os/exec"
+
+	"gopkg.in/yaml.v2"
+)
+
+// postProcessor reformats a fully-rendered template's output bytes before
+// they're written to their destination.
+type postProcessor func(rendered []byte) ([]byte, error)
+
+var postProcessors = map[string]postProcessor{
+	"gofmt":         postProcessGofmt,
+	"goimports":     postProcessGoimports,
+	"jsonpretty":    postProcessJSONPretty,
+	"yamlnormalize": postProcessYAMLNormalize,
+}
+
+// postProcessGofmt runs rendered output through go/format, which is what
+// lets p2cli be used to generate Go source from .tmpl files (in the style
+// of Apache Arrow's code generation) without shipping unformatted code.
+func postProcessGofmt(rendered []byte) ([]byte, error) {
+	formatted, err := format.Source(rendered)
+	if err != nil {
+		return nil, fmt.Errorf("gofmt: %s", err)
+	}
+	return formatted, nil
+}
+
+// postProcessGoimports shells out to a goimports binary discovered on
+// PATH, since there's no stable public API for it like go/format.Source.
+func postProcessGoimports(rendered []byte) ([]byte, error) {
+	binPath, err := exec.LookPath("goimports")
+	if err != nil {
+		return nil, fmt.Errorf("goimports: binary not found on PATH: %s", err)
+	}
+
+	cmd := exec.Command(binPath)
+	cmd.Stdin = bytes.NewReader(rendered)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("goimports: %s: %s", err, stderr.String())
+	}
+	return stdout.Bytes(), nil
+}
+
+// postProcessJSONPretty re-emits rendered JSON with two-space indentation.
+func postProcessJSONPretty(rendered []byte) ([]byte, error) {
+	var data interface{}
+	if err := json.Unmarshal(rendered, &data); err != nil {
+		return nil, fmt.Errorf("jsonpretty: %s", err)
+	}
+	pretty, err := json.MarshalIndent(data, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("jsonpretty: %s", err)
+	}
+	return append(pretty, '\n'), nil
+}
+
+// postProcessYAMLNormalize round-trips rendered YAML through the yaml
+// package so whitespace and key ordering are normalized.
+func postProcessYAMLNormalize(rendered []byte) ([]byte, error) {
+	var data interface{}
+	if err := yaml.Unmarshal(rendered, &data); err != nil {
+		return nil, fmt.Errorf("yamlnormalize: %s", err)
+	}
+	normalized, err := yaml.Marshal(data)
+	if err != nil {
+		return nil, fmt.Errorf("yamlnormalize: %s", err)
+	}
+	return normalized, nil
+}
@@ -0,0 +1,32 @@
+package main
+
+import "testing"
+
+func TestPostProcessGofmt(t *testing.T) {
+	unformatted := []byte("package main\nfunc main(){}\n")
+	formatted, err := postProcessGofmt(unformatted)
+	if err != nil {
+		t.Fatalf("postProcessGofmt() error = %v", err)
+	}
+	want := "package main\n\nfunc main() {}\n"
+	if string(formatted) != want {
+		t.Errorf("postProcessGofmt() = %q, want %q", formatted, want)
+	}
+}
+
+func TestPostProcessGofmtInvalidSource(t *testing.T) {
+	if _, err := postProcessGofmt([]byte("not valid go (((")); err == nil {
+		t.Error("expected an error for unparsable Go source")
+	}
+}
+
+func TestPostProcessJSONPretty(t *testing.T) {
+	pretty, err := postProcessJSONPretty([]byte(`{"b":1,"a":2}`))
+	if err != nil {
+		t.Fatalf("postProcessJSONPretty() error = %v", err)
+	}
+	want := "{\n  \"a\": 2,\n  \"b\": 1\n}\n"
+	if string(pretty) != want {
+		t.Errorf("postProcessJSONPretty() = %q, want %q", pretty, want)
+	}
+}
@@ -0,0 +1,291 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/flosch/pongo2"
+	log "github.com/wrouesnel/go.log"
+)
+
+// Renderer wraps the pongo2 setup (filters, autoescape, input context) so
+// a single configured instance can be reused to render many templates.
+type Renderer struct {
+	Context     pongo2.Context
+	Autoescape  bool
+	DryRun      bool
+	StripSuffix string
+	PostProcess string
+}
+
+// TemplateJob pairs a single template input with the output path it should
+// be rendered to.
+type TemplateJob struct {
+	TemplatePath string
+	OutputPath   string
+}
+
+// outputPathFor derives the output path for a template when rendering into
+// --output-dir: the template path is made relative to root (its glob root,
+// or "." for a literal --template argument) and its suffix is optionally
+// stripped.
+func outputPathFor(templatePath string, root string, outputDir string, stripSuffix string) string {
+	name := templatePath
+	if rel, err := filepath.Rel(root, templatePath); err == nil {
+		name = rel
+	}
+	if stripSuffix != "" && strings.HasSuffix(name, stripSuffix) {
+		name = strings.TrimSuffix(name, stripSuffix)
+	}
+	return filepath.Join(outputDir, name)
+}
+
+// globToRegexp translates a (possibly doublestar) glob pattern into a regexp
+// so we can walk the filesystem and match paths against it. This is enough
+// to support the `**` recursive-directory case that filepath.Glob rejects.
+func globToRegexp(pattern string) (*regexp.Regexp, error) {
+	var b strings.Builder
+	b.WriteString("^")
+	i := 0
+	for i < len(pattern) {
+		c := pattern[i]
+		switch {
+		case strings.HasPrefix(pattern[i:], "**/"):
+			// Doublestar matches zero or more path segments, so the
+			// following "/" is optional too: "configs/**/*.j2" must still
+			// match "configs/top.j2", not just files in subdirectories.
+			b.WriteString("(.*/)?")
+			i += 3
+		case strings.HasPrefix(pattern[i:], "**"):
+			b.WriteString(".*")
+			i += 2
+		case c == '*':
+			b.WriteString("[^/]*")
+			i++
+		case c == '?':
+			b.WriteString("[^/]")
+			i++
+		case strings.ContainsRune(`.+()|^$`, rune(c)):
+			b.WriteString(regexp.QuoteMeta(string(c)))
+			i++
+		default:
+			b.WriteByte(c)
+			i++
+		}
+	}
+	b.WriteString("$")
+	return regexp.Compile(b.String())
+}
+
+// templateMatch is a single file matched by a --template pattern, along
+// with the glob root it was found under (the directory --output-dir
+// mirroring should treat the path as relative to).
+type templateMatch struct {
+	Path string
+	Root string
+}
+
+// globRoot returns the directory a glob pattern's matches should be made
+// relative to when mirroring them under --output-dir: the directory
+// containing the pattern's first wildcard segment, or "." for a literal
+// (non-glob) pattern.
+func globRoot(pattern string) string {
+	if !strings.ContainsAny(pattern, "*?") {
+		return "."
+	}
+	return filepath.Dir(pattern[:strings.IndexAny(pattern, "*?")])
+}
+
+// expandTemplateMatches resolves a list of --template arguments (which may
+// contain glob or doublestar-glob patterns) into a sorted list of concrete
+// file matches, each tagged with its glob root.
+func expandTemplateMatches(patterns []string) ([]templateMatch, error) {
+	var matches []templateMatch
+	for _, pattern := range patterns {
+		root := globRoot(pattern)
+
+		if !strings.Contains(pattern, "*") && !strings.Contains(pattern, "?") {
+			matches = append(matches, templateMatch{Path: pattern, Root: root})
+			continue
+		}
+
+		if !strings.Contains(pattern, "**") {
+			globMatches, err := filepath.Glob(pattern)
+			if err != nil {
+				return nil, err
+			}
+			for _, m := range globMatches {
+				matches = append(matches, templateMatch{Path: m, Root: root})
+			}
+			continue
+		}
+
+		// Doublestar pattern: walk from the path segment preceding the
+		// first wildcard and match the rest as a regexp.
+		re, err := globToRegexp(pattern)
+		if err != nil {
+			return nil, err
+		}
+
+		err = filepath.Walk(root, func(walkPath string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if info.IsDir() {
+				return nil
+			}
+			if re.MatchString(walkPath) {
+				matches = append(matches, templateMatch{Path: walkPath, Root: root})
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	sort.Slice(matches, func(i, j int) bool { return matches[i].Path < matches[j].Path })
+	return matches, nil
+}
+
+// expandTemplates resolves a list of --template arguments (which may contain
+// glob or doublestar-glob patterns) into a sorted list of concrete file
+// paths, discarding glob-root information. It's used where only the --watch
+// file set matters, not --output-dir mirroring.
+func expandTemplates(patterns []string) ([]string, error) {
+	matches, err := expandTemplateMatches(patterns)
+	if err != nil {
+		return nil, err
+	}
+	paths := make([]string, len(matches))
+	for i, m := range matches {
+		paths[i] = m.Path
+	}
+	return paths, nil
+}
+
+// buildTemplateJobs pairs expanded template paths with their output
+// destinations, per the three supported modes: no --output (every template
+// renders to stdout), a set of --output values matching the expanded
+// templates 1:1, or an --output-dir with mirrored paths.
+func buildTemplateJobs(templatePatterns []string, outputs []string, outputDir string, stripSuffix string) ([]TemplateJob, error) {
+	templates, err := expandTemplateMatches(templatePatterns)
+	if err != nil {
+		return nil, fmt.Errorf("could not expand --template patterns: %s", err)
+	}
+	if len(templates) == 0 {
+		return nil, fmt.Errorf("no template files matched the given --template patterns")
+	}
+
+	var jobs []TemplateJob
+	switch {
+	case outputDir != "":
+		for _, tmpl := range templates {
+			jobs = append(jobs, TemplateJob{
+				TemplatePath: tmpl.Path,
+				OutputPath:   outputPathFor(tmpl.Path, tmpl.Root, outputDir, stripSuffix),
+			})
+		}
+	case len(outputs) == 0:
+		// No --output given: every template renders to stdout.
+		for _, tmpl := range templates {
+			jobs = append(jobs, TemplateJob{TemplatePath: tmpl.Path})
+		}
+	case len(outputs) == len(templates):
+		for i, tmpl := range templates {
+			jobs = append(jobs, TemplateJob{TemplatePath: tmpl.Path, OutputPath: outputs[i]})
+		}
+	default:
+		return nil, fmt.Errorf("%d --template arguments were given but %d --output arguments; these must match 1:1, or use --output-dir", len(templates), len(outputs))
+	}
+	return jobs, nil
+}
+
+// Render executes a single template job against the renderer's context,
+// honoring --dry-run by reporting the write without performing it.
+func (r *Renderer) Render(job TemplateJob) error {
+	templateBytes, err := ioutil.ReadFile(job.TemplatePath)
+	if err != nil {
+		return fmt.Errorf("could not read template file: %s", err)
+	}
+
+	if !r.Autoescape {
+		pongo2.SetAutoescape(false)
+	}
+
+	tmpl, err := pongo2.FromString(string(templateBytes))
+	if err != nil {
+		return fmt.Errorf("could not parse template: %s", err)
+	}
+
+	if r.DryRun {
+		if job.OutputPath != "" {
+			log.With("template", job.TemplatePath).With("output", job.OutputPath).Infoln("Dry run: would render template.")
+		} else {
+			log.With("template", job.TemplatePath).Infoln("Dry run: would render template to stdout.")
+		}
+		return nil
+	}
+
+	var rendered bytes.Buffer
+	if err := tmpl.ExecuteWriter(r.Context, &rendered); err != nil {
+		return fmt.Errorf("could not render template: %s", err)
+	}
+
+	output := rendered.Bytes()
+	if r.PostProcess != "" {
+		postProcess, ok := postProcessors[r.PostProcess]
+		if !ok {
+			return fmt.Errorf("unknown --postprocess filter: %s", r.PostProcess)
+		}
+		processed, err := postProcess(output)
+		if err != nil {
+			return fmt.Errorf("--postprocess %s failed on %s: %s", r.PostProcess, job.TemplatePath, err)
+		}
+		output = processed
+	}
+
+	var outputWriter io.Writer
+	if job.OutputPath != "" {
+		if dir := filepath.Dir(job.OutputPath); dir != "." {
+			if err := os.MkdirAll(dir, 0755); err != nil {
+				return fmt.Errorf("could not create output directory: %s", err)
+			}
+		}
+		fileOut, err := os.OpenFile(job.OutputPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, os.FileMode(0777))
+		if err != nil {
+			return fmt.Errorf("could not open output file for writing: %s", err)
+		}
+		defer func() { _ = fileOut.Close() }()
+		outputWriter = fileOut
+	} else {
+		outputWriter = os.Stdout
+	}
+
+	if _, err := outputWriter.Write(output); err != nil {
+		return fmt.Errorf("could not write rendered output: %s", err)
+	}
+	return nil
+}
+
+// RenderAll runs every job, continuing past individual failures and
+// returning the count of jobs that failed so the caller can derive an
+// aggregate exit code.
+func (r *Renderer) RenderAll(jobs []TemplateJob) int {
+	failures := 0
+	for _, job := range jobs {
+		if err := r.Render(job); err != nil {
+			log.With("template", job.TemplatePath).Errorln("Error rendering template:", err)
+			failures++
+			continue
+		}
+	}
+	return failures
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestOutputPathForRelativizesToGlobRoot(t *testing.T) {
+	got := outputPathFor(filepath.Join("configs", "sub", "app.conf.j2"), "configs", "out", ".j2")
+	want := filepath.Join("out", "sub", "app.conf")
+	if got != want {
+		t.Errorf("outputPathFor() = %q, want %q", got, want)
+	}
+}
+
+func TestOutputPathForLiteralTemplateKeepsFullPath(t *testing.T) {
+	got := outputPathFor(filepath.Join("configs", "app.conf.j2"), ".", "out", ".j2")
+	want := filepath.Join("out", "configs", "app.conf")
+	if got != want {
+		t.Errorf("outputPathFor() = %q, want %q", got, want)
+	}
+}
+
+func TestExpandTemplatesDoublestarMatchesTopLevelFiles(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "sub"), 0755); err != nil {
+		t.Fatalf("could not create fixture subdirectory: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "top.j2"), []byte(""), 0644); err != nil {
+		t.Fatalf("could not write fixture file: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "sub", "nested.j2"), []byte(""), 0644); err != nil {
+		t.Fatalf("could not write fixture file: %v", err)
+	}
+
+	matches, err := expandTemplates([]string{filepath.Join(dir, "**", "*.j2")})
+	if err != nil {
+		t.Fatalf("expandTemplates() error = %v", err)
+	}
+
+	want := []string{
+		filepath.Join(dir, "sub", "nested.j2"),
+		filepath.Join(dir, "top.j2"),
+	}
+	if len(matches) != len(want) {
+		t.Fatalf("expandTemplates() = %v, want %v (doublestar should match files directly in the glob root too)", matches, want)
+	}
+	for i := range want {
+		if matches[i] != want[i] {
+			t.Errorf("expandTemplates()[%d] = %q, want %q", i, matches[i], want[i])
+		}
+	}
+}
+
+func TestExpandTemplatesReturnsSortedMatches(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"c.j2", "a.j2", "b.j2"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(""), 0644); err != nil {
+			t.Fatalf("could not write fixture file: %v", err)
+		}
+	}
+
+	matches, err := expandTemplates([]string{filepath.Join(dir, "*.j2")})
+	if err != nil {
+		t.Fatalf("expandTemplates() error = %v", err)
+	}
+
+	want := []string{
+		filepath.Join(dir, "a.j2"),
+		filepath.Join(dir, "b.j2"),
+		filepath.Join(dir, "c.j2"),
+	}
+	if len(matches) != len(want) {
+		t.Fatalf("expandTemplates() = %v, want %v", matches, want)
+	}
+	for i := range want {
+		if matches[i] != want[i] {
+			t.Errorf("expandTemplates()[%d] = %q, want %q", i, matches[i], want[i])
+		}
+	}
+}
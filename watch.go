@@ -0,0 +1,114 @@
+package main
+
+import (
+	"os/exec"
+	"path/filepath"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/kballard/go-shellquote"
+	log "github.com/wrouesnel/go.log"
+)
+
+// watchOptions configures the fsnotify-backed re-render loop driven by
+// RunWatcher.
+type watchOptions struct {
+	// WatchedFiles are the individual files to watch: templates, --input
+	// files and anything matched by --watch-path.
+	WatchedFiles []string
+	// Delay debounces bursts of filesystem events (e.g. an editor doing a
+	// write-then-rename) into a single re-render.
+	Delay time.Duration
+	// OnChange, if non-empty, is a shell command run after each successful
+	// re-render (e.g. to SIGHUP a service that consumes the rendered file).
+	OnChange string
+}
+
+// RunWatcher blocks, calling render() once up front and again every time one
+// of opts.WatchedFiles changes on disk, debounced by opts.Delay. Errors from
+// render are logged but never terminate the watch loop. RunWatcher only
+// returns if the underlying fsnotify watcher cannot be set up.
+//
+// fsnotify watches are registered on each watched file's parent directory
+// rather than the file itself: editors commonly save by writing a temp file
+// and renaming it over the original, which replaces the inode and would
+// silently kill a per-file watch. Directory events are then filtered back
+// down to opts.WatchedFiles so unrelated sibling files don't trigger a
+// re-render.
+func RunWatcher(opts watchOptions, render func() error) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	defer func() { _ = watcher.Close() }()
+
+	watchedFiles := make(map[string]bool, len(opts.WatchedFiles))
+	watchedDirs := make(map[string]bool)
+	for _, watchedFile := range opts.WatchedFiles {
+		watchedFiles[filepath.Clean(watchedFile)] = true
+
+		dir := filepath.Dir(watchedFile)
+		if watchedDirs[dir] {
+			continue
+		}
+		if err := watcher.Add(dir); err != nil {
+			return err
+		}
+		watchedDirs[dir] = true
+	}
+
+	rerender := func() {
+		if err := render(); err != nil {
+			log.Errorln("Error re-rendering after a watched file changed:", err)
+			return
+		}
+		if opts.OnChange != "" {
+			runOnChange(opts.OnChange)
+		}
+	}
+
+	rerender()
+
+	var debounce *time.Timer
+	for {
+		select {
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return nil
+			}
+			if !watchedFiles[filepath.Clean(event.Name)] {
+				continue
+			}
+			log.With("file", event.Name).With("op", event.Op.String()).Debugln("Watched file changed.")
+
+			if debounce == nil {
+				debounce = time.AfterFunc(opts.Delay, rerender)
+			} else {
+				debounce.Reset(opts.Delay)
+			}
+		case watchErr, ok := <-watcher.Errors:
+			if !ok {
+				return nil
+			}
+			log.Errorln("Watcher error:", watchErr)
+		}
+	}
+}
+
+// runOnChange parses and executes the --on-change command, logging (but not
+// propagating) any failure so the watcher keeps running.
+func runOnChange(command string) {
+	args, err := shellquote.Split(command)
+	if err != nil {
+		log.Errorln("Could not parse --on-change command:", err)
+		return
+	}
+	if len(args) == 0 {
+		return
+	}
+
+	cmd := exec.Command(args[0], args[1:]...)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		log.With("output", string(output)).Errorln("--on-change command failed:", err)
+	}
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRunWatcherSurvivesAtomicSave(t *testing.T) {
+	dir := t.TempDir()
+	watched := filepath.Join(dir, "data.env")
+	if err := os.WriteFile(watched, []byte("A=1\n"), 0644); err != nil {
+		t.Fatalf("could not write fixture file: %v", err)
+	}
+
+	var renders int32
+	done := make(chan struct{}, 1)
+	render := func() error {
+		if atomic.AddInt32(&renders, 1) == 2 {
+			select {
+			case done <- struct{}{}:
+			default:
+			}
+		}
+		return nil
+	}
+
+	stop := make(chan struct{})
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- RunWatcher(watchOptions{
+			WatchedFiles: []string{watched},
+			Delay:        10 * time.Millisecond,
+		}, func() error {
+			select {
+			case <-stop:
+				return nil
+			default:
+			}
+			return render()
+		})
+	}()
+
+	// Give the watcher time to register, then simulate an editor's
+	// write-then-rename atomic save over the original inode.
+	time.Sleep(50 * time.Millisecond)
+	tmp := watched + ".tmp"
+	if err := os.WriteFile(tmp, []byte("A=2\n"), 0644); err != nil {
+		t.Fatalf("could not write replacement file: %v", err)
+	}
+	if err := os.Rename(tmp, watched); err != nil {
+		t.Fatalf("could not rename replacement file into place: %v", err)
+	}
+
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("RunWatcher did not re-render after an atomic save replaced the watched file")
+	}
+	close(stop)
+}